@@ -0,0 +1,58 @@
+// Command shim is the dstack-runner shim: it installs the dstack-runner
+// binary (or, in container mode, pulls its image) onto a dstack instance and
+// launches it. shim.CLIArgs/shim.RunnerArgs carry the flags this command
+// parses; see package shim for the install/run logic itself.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/dstackai/dstack/runner/internal/shim"
+)
+
+func main() {
+	c := parseFlags()
+
+	if err := c.DownloadRunner(); err != nil {
+		log.Fatalf("install dstack-runner: %s\n", err)
+	}
+
+	if c.Runner.Mode == shim.ModeContainer {
+		if err := c.RunContainer(context.Background()); err != nil {
+			log.Fatalf("run dstack-runner container: %s\n", err)
+		}
+		return
+	}
+
+	for _, cmd := range c.GetDockerCommands() {
+		fmt.Println(cmd)
+	}
+}
+
+// parseFlags wires RunnerArgs to the shim's command-line flags.
+func parseFlags() *shim.CLIArgs {
+	c := &shim.CLIArgs{}
+
+	flag.StringVar(&c.Runner.Version, "version", "latest", "dstack-runner version to install")
+	flag.BoolVar(&c.Runner.DevChannel, "dev-channel", false, "install from the staging bucket instead of the release bucket")
+	flag.IntVar(&c.Runner.LogLevel, "log-level", 0, "dstack-runner log level")
+	flag.IntVar(&c.Runner.HTTPPort, "http-port", 10999, "port dstack-runner listens on")
+	flag.StringVar(&c.Runner.TempDir, "temp-dir", "/tmp/dstack", "dstack-runner temp directory")
+	flag.StringVar(&c.Runner.HomeDir, "home-dir", "/root", "dstack-runner home directory")
+	flag.StringVar(&c.Runner.WorkingDir, "working-dir", "/root/workflow", "dstack-runner working directory")
+
+	flag.StringVar(&c.Runner.OS, "os", "", "override the target OS (default: auto-detect)")
+	flag.StringVar(&c.Runner.Arch, "arch", "", "override the target architecture (default: auto-detect)")
+	flag.StringVar(&c.Runner.Source, "source", "", `where to download dstack-runner from: "s3" (default) or "github"`)
+	flag.StringVar(&c.Runner.Mode, "mode", shim.ModeBinary, `how to run dstack-runner: "binary" (default) or "container"`)
+
+	flag.BoolVar(&c.Runner.InsecureSkipSignature, "insecure-skip-signature", false, "skip dstack-runner signature verification (development only)")
+	flag.StringVar(&c.Runner.RootKeysFile, "root-keys-file", "", "override the compiled-in signing root keys, for tests and non-production environments")
+	flag.IntVar(&c.Runner.MaxRetries, "max-retries", 0, "maximum download retry attempts (default: download package's own default)")
+
+	flag.Parse()
+	return c
+}
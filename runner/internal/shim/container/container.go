@@ -0,0 +1,208 @@
+// Package container runs dstack-runner as a Docker container instead of a
+// host binary, pulling a versioned OCI image via the Docker Engine API
+// instead of the shim's own download/signature pipeline. Content-addressable
+// image digests give the same integrity guarantee the S3 path gets from
+// package signing, without needing a separate signing scheme for this mode.
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// ImageTemplate is the OCI image dstack-runner container mode pulls,
+// parameterized by version in the same way the S3 path is by URL.
+const ImageTemplate = "dstackai/dstack-runner:%s"
+
+// ContainerName is the fixed name the shim runs the runner container under,
+// so a restart finds (and replaces) its own previous container rather than
+// accumulating one per crash.
+const ContainerName = "dstack-runner"
+
+// restartBackoff is how long Run waits before relaunching a crashed
+// container, so a container that fails immediately on start doesn't spin
+// the Docker daemon with back-to-back create/start calls. A var (not a
+// const) so tests can shrink it instead of sleeping for real.
+var restartBackoff = 5 * time.Second
+
+// RunOptions mirrors the host-binary flags the runner needs, plus the
+// version used to select the image tag.
+type RunOptions struct {
+	Version    string
+	LogLevel   int
+	HTTPPort   int
+	TempDir    string
+	HomeDir    string
+	WorkingDir string
+	// RestartOnCrash keeps relaunching the container after a non-zero exit.
+	RestartOnCrash bool
+}
+
+// RunnerCmd renders the dstack-runner start command for opts, the same
+// argument list the binary-mode shim passes on its command line. Callers
+// that only need the command string (e.g. a `docker run` invocation) and
+// callers that drive the Engine API directly (runOnce) both go through this
+// so the two never drift apart.
+func RunnerCmd(opts RunOptions) []string {
+	return []string{
+		"--log-level", strconv.Itoa(opts.LogLevel),
+		"start",
+		"--http-port", strconv.Itoa(opts.HTTPPort),
+		"--temp-dir", opts.TempDir,
+		"--home-dir", opts.HomeDir,
+		"--working-dir", opts.WorkingDir,
+	}
+}
+
+// Supervisor pulls and runs the dstack-runner image through the Docker
+// Engine API, optionally restarting it on crash and streaming its logs to
+// the shim's own stdout/stderr.
+type Supervisor struct {
+	cli *client.Client
+}
+
+// NewSupervisor connects to the local Docker Engine using the standard
+// DOCKER_HOST/DOCKER_* environment variables.
+func NewSupervisor() (*Supervisor, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return &Supervisor{cli: cli}, nil
+}
+
+// Run pulls the runner image for opts.Version and runs it until it exits or
+// ctx is canceled. A non-zero exit relaunches it when opts.RestartOnCrash is
+// set; a zero exit, or any exit without RestartOnCrash, returns nil.
+func (s *Supervisor) Run(ctx context.Context, opts RunOptions) error {
+	image := fmt.Sprintf(ImageTemplate, opts.Version)
+
+	if err := s.pullImage(ctx, image); err != nil {
+		return gerrors.Wrap(err)
+	}
+
+	for {
+		exitCode, err := s.runOnce(ctx, image, opts)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if exitCode == 0 || !opts.RestartOnCrash {
+			// runOnce leaves the stopped container behind so its logs and
+			// exit code stay inspectable between restarts; once we're not
+			// restarting there's nothing left to inspect, so clean it up the
+			// way `docker run --rm` would.
+			_ = s.cli.ContainerRemove(ctx, ContainerName, types.ContainerRemoveOptions{Force: true})
+			return nil
+		}
+		log.Printf("dstack-runner container exited with code %d, restarting in %s\n", exitCode, restartBackoff)
+
+		select {
+		case <-ctx.Done():
+			return gerrors.Wrap(ctx.Err())
+		case <-time.After(restartBackoff):
+		}
+	}
+}
+
+func (s *Supervisor) pullImage(ctx context.Context, image string) error {
+	log.Printf("Pulling %s\n", image)
+
+	reader, err := s.cli.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer reader.Close()
+
+	// Drain the pull progress stream; docker only reports completion once
+	// the caller has read it to EOF.
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+// runOnce creates, starts and waits for a single run of the runner
+// container, streaming its logs until it exits. It returns the container's
+// exit code.
+func (s *Supervisor) runOnce(ctx context.Context, image string, opts RunOptions) (int64, error) {
+	_ = s.cli.ContainerRemove(ctx, ContainerName, types.ContainerRemoveOptions{Force: true})
+
+	containerPort, err := nat.NewPort("tcp", strconv.Itoa(opts.HTTPPort))
+	if err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+
+	resp, err := s.cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        image,
+			Cmd:          RunnerCmd(opts),
+			ExposedPorts: nat.PortSet{containerPort: struct{}{}},
+		},
+		&container.HostConfig{
+			PortBindings: nat.PortMap{
+				containerPort: []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(opts.HTTPPort)}},
+			},
+			Mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: opts.TempDir, Target: opts.TempDir},
+				{Type: mount.TypeBind, Source: opts.HomeDir, Target: opts.HomeDir},
+				{Type: mount.TypeBind, Source: opts.WorkingDir, Target: opts.WorkingDir},
+			},
+		},
+		nil, nil, ContainerName,
+	)
+	if err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+
+	if err := s.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+
+	go s.streamLogs(ctx, resp.ID)
+
+	statusCh, errCh := s.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return 0, gerrors.Wrap(err)
+	case status := <-statusCh:
+		return status.StatusCode, nil
+	case <-ctx.Done():
+		return 0, gerrors.Wrap(ctx.Err())
+	}
+}
+
+// streamLogs attaches to the container's stdout/stderr and mirrors them to
+// the shim's own, until ctx is canceled or the container stops logging.
+func (s *Supervisor) streamLogs(ctx context.Context, containerID string) {
+	out, err := s.cli.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		log.Printf("attach to dstack-runner container logs: %s\n", err)
+		return
+	}
+	defer out.Close()
+
+	// ContainerLogs without a TTY multiplexes stdout/stderr into a single
+	// stream with an 8-byte frame header per chunk; stdcopy.StdCopy is the
+	// Docker SDK's own demuxer for that format.
+	if _, err := stdcopy.StdCopy(os.Stdout, os.Stderr, out); err != nil && ctx.Err() == nil {
+		log.Printf("stream dstack-runner container logs: %s\n", err)
+	}
+}
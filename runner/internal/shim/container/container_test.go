@@ -0,0 +1,132 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+func TestImageTemplate(t *testing.T) {
+	got := fmt.Sprintf(ImageTemplate, "0.18.3")
+	want := "dstackai/dstack-runner:0.18.3"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// newFakeEngineAPI serves just enough of the Docker Engine API (image pull,
+// container create/start/wait/logs/remove) for Supervisor.Run to drive end
+// to end against it, without a real Docker daemon. waitStatusCodes is
+// consumed one element per ContainerWait call; the last element repeats once
+// exhausted.
+func newFakeEngineAPI(t *testing.T, waitStatusCodes []int64) (server *httptest.Server, createCalls, removeCalls *int32) {
+	t.Helper()
+
+	createCalls = new(int32)
+	removeCalls = new(int32)
+	var waitCalls int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete:
+			atomic.AddInt32(removeCalls, 1)
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/images/create"):
+			w.WriteHeader(http.StatusOK)
+		case strings.HasSuffix(r.URL.Path, "/containers/create"):
+			atomic.AddInt32(createCalls, 1)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Id": "fake-container", "Warnings": []string{}})
+		case strings.HasSuffix(r.URL.Path, "/start"):
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasSuffix(r.URL.Path, "/logs"):
+			w.WriteHeader(http.StatusOK)
+		case strings.HasSuffix(r.URL.Path, "/wait"):
+			i := int(atomic.AddInt32(&waitCalls, 1)) - 1
+			if i >= len(waitStatusCodes) {
+				i = len(waitStatusCodes) - 1
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"StatusCode": waitStatusCodes[i]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	server = httptest.NewServer(mux)
+	return server, createCalls, removeCalls
+}
+
+func newFakeSupervisor(t *testing.T, server *httptest.Server) *Supervisor {
+	t.Helper()
+	cli, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")),
+		client.WithVersion("1.41"),
+	)
+	if err != nil {
+		t.Fatalf("build fake docker client: %s", err)
+	}
+	return &Supervisor{cli: cli}
+}
+
+func TestSupervisorRunRestartsOnCrashThenStops(t *testing.T) {
+	orig := restartBackoff
+	restartBackoff = 10 * time.Millisecond
+	defer func() { restartBackoff = orig }()
+
+	server, createCalls, removeCalls := newFakeEngineAPI(t, []int64{137, 0})
+	defer server.Close()
+
+	s := newFakeSupervisor(t, server)
+
+	err := s.Run(context.Background(), RunOptions{
+		Version:        "0.18.3",
+		HTTPPort:       10999,
+		TempDir:        t.TempDir(),
+		HomeDir:        t.TempDir(),
+		WorkingDir:     t.TempDir(),
+		RestartOnCrash: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := atomic.LoadInt32(createCalls); got != 2 {
+		t.Fatalf("expected a fresh container create per run (1 crash + 1 clean exit), got %d", got)
+	}
+	if got := atomic.LoadInt32(removeCalls); got == 0 {
+		t.Fatalf("expected the container to be removed at least once")
+	}
+}
+
+func TestSupervisorRunStopsWithoutRestartOnCrashWhenDisabled(t *testing.T) {
+	server, createCalls, _ := newFakeEngineAPI(t, []int64{137})
+	defer server.Close()
+
+	s := newFakeSupervisor(t, server)
+
+	err := s.Run(context.Background(), RunOptions{
+		Version:        "0.18.3",
+		HTTPPort:       10999,
+		TempDir:        t.TempDir(),
+		HomeDir:        t.TempDir(),
+		WorkingDir:     t.TempDir(),
+		RestartOnCrash: false,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := atomic.LoadInt32(createCalls); got != 1 {
+		t.Fatalf("expected exactly one container run, got %d", got)
+	}
+}
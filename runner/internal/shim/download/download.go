@@ -0,0 +1,391 @@
+// Package download implements a resumable, progress-reporting HTTP download
+// used by the shim to fetch the dstack-runner binary (and, in the future,
+// other large artifacts such as images) without losing the transfer to a
+// flaky connection.
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// ProgressFunc is called periodically as a download makes progress.
+// total is -1 when the server did not report a Content-Length.
+type ProgressFunc func(done, total int64)
+
+// Options configures a Download call. The zero value is usable; unset
+// fields fall back to sane defaults.
+type Options struct {
+	// ProgressFunc, if set, is called roughly every ProgressPeriod and
+	// once more when the download finishes.
+	ProgressFunc ProgressFunc
+	// ProgressPeriod is how often ProgressFunc is invoked. Defaults to 5s.
+	ProgressPeriod time.Duration
+	// MaxRetries is how many times a failed attempt is retried with
+	// exponential backoff before giving up. Defaults to 5.
+	MaxRetries int
+	// IdleTimeout aborts an attempt if no bytes are read for this long,
+	// as opposed to bounding the download's total duration. Defaults to 60s.
+	IdleTimeout time.Duration
+	// VerifyChecksum, if true, fetches "<url>.sha256" and verifies the
+	// downloaded file against it before the final rename.
+	VerifyChecksum bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.ProgressPeriod <= 0 {
+		o.ProgressPeriod = 5 * time.Second
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 5
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 60 * time.Second
+	}
+	return o
+}
+
+// Download fetches url into destPath, resuming a previously interrupted
+// attempt when possible and retrying transient failures. destPath is only
+// created once the download is complete and verified; until then progress is
+// kept in a partial file next to it.
+func Download(ctx context.Context, url, destPath string, opts Options) error {
+	opts = opts.withDefaults()
+
+	partialPath := partialFilePath(destPath, url)
+
+	var lastErr error
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			wait := backoff(attempt)
+			log.Printf("Download of %s failed (%s), retrying in %s (attempt %d/%d)\n", url, lastErr, wait, attempt, opts.MaxRetries)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return gerrors.Wrap(ctx.Err())
+			}
+		}
+
+		err := attemptDownload(ctx, url, partialPath, opts)
+		if err == nil {
+			lastErr = nil
+			break
+		}
+		if !isRetryable(err) {
+			return gerrors.Wrap(err)
+		}
+		lastErr = err
+	}
+	if lastErr != nil {
+		return gerrors.Wrap(lastErr)
+	}
+
+	if opts.VerifyChecksum {
+		if err := verifyChecksum(ctx, url, partialPath, opts); err != nil {
+			if isNotFoundErr(err) {
+				// The bucket doesn't publish a checksum sidecar for this URL
+				// (yet) rather than publishing one that's wrong; don't turn a
+				// missing optional artifact into a hard failure.
+				log.Printf("WARNING: no checksum sidecar published for %s, skipping checksum verification\n", url)
+			} else {
+				_ = os.Remove(partialPath)
+				return gerrors.Wrap(err)
+			}
+		}
+	}
+
+	if err := os.Rename(partialPath, destPath); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+// attemptDownload performs a single (possibly resumed) download attempt,
+// appending to an existing partial file via a Range request when the server
+// supports it.
+func attemptDownload(ctx context.Context, url, partialPath string, opts Options) error {
+	var resumeFrom int64
+	if info, err := os.Stat(partialPath); err == nil {
+		resumeFrom = info.Size()
+	}
+
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer file.Close()
+
+	// The request carries a cancelable ctx so the idle timer below can abort
+	// a stalled body read.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if resumeFrom > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeFrom))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Server ignored our Range request (or we didn't send one): start over.
+		if resumeFrom > 0 {
+			if err := file.Truncate(0); err != nil {
+				return gerrors.Wrap(err)
+			}
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return gerrors.Wrap(err)
+			}
+			resumeFrom = 0
+		}
+	case http.StatusPartialContent:
+		if _, err := file.Seek(resumeFrom, io.SeekStart); err != nil {
+			return gerrors.Wrap(err)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Our partial file is already complete, or stale; restart clean.
+		if err := file.Truncate(0); err != nil {
+			return gerrors.Wrap(err)
+		}
+		return gerrors.Newf("range not satisfiable, will restart: %s", resp.Status)
+	default:
+		return newHTTPError(resp.StatusCode, resp.Status)
+	}
+
+	total := resumeFrom + resp.ContentLength
+	if resp.ContentLength < 0 {
+		total = -1
+	}
+
+	idle := newIdleTimeoutReader(resp.Body, opts.IdleTimeout, cancel)
+	defer idle.Stop()
+
+	pr := &progressReader{
+		r:      idle,
+		done:   resumeFrom,
+		total:  total,
+		fn:     opts.ProgressFunc,
+		period: opts.ProgressPeriod,
+	}
+
+	if _, err := io.Copy(file, pr); err != nil {
+		if idle.fired {
+			return gerrors.Newf("idle timeout: no data received for %s", opts.IdleTimeout)
+		}
+		return gerrors.Wrap(err)
+	}
+
+	pr.report()
+	return nil
+}
+
+// partialFilePath derives a stable on-disk name for an in-progress download
+// of url, alongside destPath, so a retry or a restarted shim can resume it.
+func partialFilePath(destPath, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(filepath.Dir(destPath), fmt.Sprintf(".%s.%s.part", filepath.Base(destPath), hex.EncodeToString(sum[:])[:16]))
+}
+
+func backoff(attempt int) time.Duration {
+	base := 500 * time.Millisecond * time.Duration(1<<uint(attempt))
+	if base > 30*time.Second {
+		base = 30 * time.Second
+	}
+	jitter := time.Duration(rand.Int63n(int64(base) / 2))
+	return base + jitter
+}
+
+func isRetryable(err error) bool {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500
+	}
+	// Network errors (timeouts, connection resets, idle timeout, DNS
+	// hiccups) are assumed transient.
+	return true
+}
+
+// isNotFoundErr reports whether err is an HTTP 404, used to tell "this
+// sidecar isn't published yet" apart from a real verification failure.
+func isNotFoundErr(err error) bool {
+	var httpErr *httpError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound
+}
+
+type httpError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("unexpected status code: %s", e.Status)
+}
+
+func newHTTPError(code int, status string) error {
+	return &httpError{StatusCode: code, Status: status}
+}
+
+// verifyChecksum fetches "<url>.sha256" and compares it against path's own
+// hash. It gets the same retry/backoff treatment as the binary download
+// itself, since a checksum sidecar is just as prone to a flaky connection.
+// fetchChecksum's error is returned unwrapped so the caller can tell a
+// missing sidecar (isNotFoundErr) apart from one that's actually wrong.
+func verifyChecksum(ctx context.Context, url, path string, opts Options) error {
+	body, err := fetchChecksum(ctx, url, opts)
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return gerrors.Newf("checksum file for %s is empty", url)
+	}
+	want := strings.ToLower(fields[0])
+
+	f, err := os.Open(path)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return gerrors.Wrap(err)
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+
+	if got != want {
+		return gerrors.Newf("checksum mismatch: got %s, want %s", got, want)
+	}
+	return nil
+}
+
+// fetchChecksum fetches "<url>.sha256", retrying transient failures with the
+// same backoff as Download. Errors are returned unwrapped; see
+// verifyChecksum.
+func fetchChecksum(ctx context.Context, url string, opts Options) ([]byte, error) {
+	checksumURL := url + ".sha256"
+
+	var lastErr error
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			wait := backoff(attempt)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		body, err := attemptFetchChecksum(ctx, checksumURL, opts.IdleTimeout)
+		if err == nil {
+			return body, nil
+		}
+		if !isRetryable(err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func attemptFetchChecksum(ctx context.Context, checksumURL string, idleTimeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, idleTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checksumURL, nil)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newHTTPError(resp.StatusCode, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// idleTimeoutReader cancels cancel if no bytes are Read for timeout, so a
+// connection that stalls (rather than erroring) doesn't hang forever.
+type idleTimeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	fired   bool
+	timer   *time.Timer
+}
+
+func newIdleTimeoutReader(r io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	t := &idleTimeoutReader{r: r, timeout: timeout}
+	t.timer = time.AfterFunc(timeout, func() {
+		t.fired = true
+		cancel()
+	})
+	return t
+}
+
+func (t *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		t.timer.Reset(t.timeout)
+	}
+	return n, err
+}
+
+func (t *idleTimeoutReader) Stop() {
+	t.timer.Stop()
+}
+
+// progressReader wraps a reader to report progress via fn, at most once per
+// period plus a final call once the caller is done.
+type progressReader struct {
+	r      io.Reader
+	done   int64
+	total  int64
+	fn     ProgressFunc
+	period time.Duration
+	last   time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.fn != nil && time.Since(p.last) >= p.period {
+		p.report()
+	}
+	return n, err
+}
+
+func (p *progressReader) report() {
+	if p.fn == nil {
+		return
+	}
+	p.fn(p.done, p.total)
+	p.last = time.Now()
+}
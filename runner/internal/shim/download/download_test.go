@@ -0,0 +1,235 @@
+package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloadFresh(t *testing.T) {
+	content := []byte("dstack-runner binary contents")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	var lastDone, lastTotal int64
+	opts := Options{
+		ProgressFunc: func(done, total int64) {
+			lastDone, lastTotal = done, total
+		},
+	}
+
+	if err := Download(context.Background(), server.URL, dest, opts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read dest: %s", err)
+	}
+	if string(got) != string(content) {
+		t.Fatalf("downloaded content mismatch")
+	}
+	if lastDone != int64(len(content)) || lastTotal != int64(len(content)) {
+		t.Fatalf("expected final progress %d/%d, got %d/%d", len(content), len(content), lastDone, lastTotal)
+	}
+}
+
+func TestDownloadResumesAfterDrop(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	splitAt := 10
+
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			// Would send only the first half, then drop the connection. Not
+			// reached here: hits is preset to 1 below, after seeding the
+			// partial file, so every request takes the Range branch.
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(content[:splitAt])
+			return
+		}
+
+		rangeHeader := r.Header.Get("Range")
+		if rangeHeader != fmt.Sprintf("bytes=%d-", splitAt) {
+			t.Errorf("expected resume Range header, got %q", rangeHeader)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", splitAt, len(content)-1, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[splitAt:])
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	// Seed the partial file as if a previous attempt had already written the
+	// first half, so this run should send a Range request for the rest.
+	partial := partialFilePath(dest, server.URL)
+	if err := os.WriteFile(partial, content[:splitAt], 0644); err != nil {
+		t.Fatalf("seed partial file: %s", err)
+	}
+	atomic.StoreInt32(&hits, 1)
+
+	if err := Download(context.Background(), server.URL, dest, Options{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read dest: %s", err)
+	}
+	if string(got) != string(content) {
+		t.Fatalf("resumed content mismatch: got %q, want %q", got, content)
+	}
+}
+
+func TestDownloadRetriesOn5xx(t *testing.T) {
+	content := []byte("retry me")
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	if err := Download(context.Background(), server.URL, dest, Options{MaxRetries: 3}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestDownloadGivesUpAfterMaxRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	err := Download(context.Background(), server.URL, dest, Options{MaxRetries: 2})
+	if err == nil {
+		t.Fatalf("expected an error after exhausting retries")
+	}
+}
+
+func TestDownloadVerifiesChecksum(t *testing.T) {
+	content := []byte("checksum me")
+	sum := sha256.Sum256(content)
+	hexSum := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binary.sha256" {
+			io.WriteString(w, hexSum)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	if err := Download(context.Background(), server.URL+"/binary", dest, Options{VerifyChecksum: true}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestDownloadRejectsEmptyChecksum(t *testing.T) {
+	content := []byte("checksum me")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binary.sha256" {
+			// Malformed sidecar: reachable, 200 OK, but no checksum in the body.
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	err := Download(context.Background(), server.URL+"/binary", dest, Options{VerifyChecksum: true})
+	if err == nil {
+		t.Fatalf("expected an error for an empty checksum body")
+	}
+}
+
+func TestDownloadSkipsMissingChecksumSidecar(t *testing.T) {
+	content := []byte("checksum me")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binary.sha256" {
+			// No sidecar published for this binary at all - a 404, not a
+			// malformed 200.
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	if err := Download(context.Background(), server.URL+"/binary", dest, Options{VerifyChecksum: true}); err != nil {
+		t.Fatalf("unexpected error for a missing checksum sidecar: %s", err)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("read dest: %s", err)
+	}
+	if string(got) != string(content) {
+		t.Fatalf("downloaded content mismatch")
+	}
+}
+
+func TestDownloadRejectsChecksumMismatch(t *testing.T) {
+	content := []byte("checksum me")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binary.sha256" {
+			io.WriteString(w, "0000000000000000000000000000000000000000000000000000000000000000")
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dstack-runner")
+
+	err := Download(context.Background(), server.URL+"/binary", dest, Options{VerifyChecksum: true})
+	if err == nil {
+		t.Fatalf("expected checksum mismatch error")
+	}
+	if _, statErr := os.Stat(dest); statErr == nil {
+		t.Fatalf("dest file should not exist after a checksum failure")
+	}
+}
@@ -2,16 +2,28 @@ package shim
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/shim/container"
+	"github.com/dstackai/dstack/runner/internal/shim/download"
+	"github.com/dstackai/dstack/runner/internal/shim/source"
+	"github.com/dstackai/dstack/runner/internal/signing"
 )
 
 const (
@@ -19,19 +31,171 @@ const (
 	DstackReleaseBucket    = "dstack-runner-downloads"
 	DstackStagingBucket    = "dstack-runner-downloads-stgn"
 	DstackRunnerBinaryName = "/usr/local/bin/dstack-runner"
+	DstackGitHubRepo       = "dstackai/dstack"
 )
 
+// SupportedPlatforms is the matrix of OS/arch combinations the release
+// pipeline publishes a dstack-runner binary for.
+var SupportedPlatforms = map[string][]string{
+	"linux":  {"amd64", "arm64", "ppc64le", "s390x"},
+	"darwin": {"arm64"},
+}
+
+// RunnerArgs are the shim flags that control how the dstack-runner binary is
+// located, verified and launched.
+type RunnerArgs struct {
+	Version    string
+	DevChannel bool
+	LogLevel   int
+	HTTPPort   int
+	TempDir    string
+	HomeDir    string
+	WorkingDir string
+	BinaryPath string
+
+	// InsecureSkipSignature disables runner binary signature verification.
+	// It exists for local development only and must never be set in
+	// production deployments.
+	InsecureSkipSignature bool
+	// RootKeysFile overrides signing.RootKeys, used in tests to sign
+	// fixtures with throwaway keys instead of the real production roots.
+	RootKeysFile string
+
+	// ProgressFunc, if set, receives periodic download progress updates.
+	ProgressFunc download.ProgressFunc
+	// MaxRetries bounds how many times a failed download attempt is
+	// retried with exponential backoff. Defaults to download.Options' own
+	// default when left at zero.
+	MaxRetries int
+
+	// OS overrides runtime.GOOS for selecting which dstack-runner binary to
+	// download. Empty means auto-detect.
+	OS string
+	// Arch overrides runtime.GOARCH for selecting which dstack-runner
+	// binary to download. Empty means auto-detect.
+	Arch string
+
+	// Source selects where the dstack-runner binary is downloaded from:
+	// "s3" (default, the original bucket) or "github" (GitHub Releases).
+	Source string
+
+	// Mode selects how the dstack-runner binary is executed: "binary"
+	// (default, a host process started by the instance's entrypoint script)
+	// or "container" (a Docker container pulled and supervised directly by
+	// the shim via container.Supervisor).
+	Mode string
+}
+
+const (
+	ModeBinary    = "binary"
+	ModeContainer = "container"
+)
+
+// CLIArgs holds the parsed shim command-line arguments; see
+// runner/cmd/shim/main.go for the flag definitions that populate it.
+type CLIArgs struct {
+	Runner RunnerArgs
+}
+
 func (c *CLIArgs) GetDockerCommands() []string {
+	if c.Runner.Mode == ModeContainer {
+		return []string{
+			fmt.Sprintf("docker run --rm --name %s %s %s %s",
+				container.ContainerName,
+				strings.Join(c.getContainerPortsAndMounts(), " "),
+				fmt.Sprintf(container.ImageTemplate, c.Runner.Version),
+				strings.Join(container.RunnerCmd(c.containerRunOptions()), " "),
+			),
+		}
+	}
+
+	binaryPath, err := RunnerBinaryPath(c.resolvedOS())
+	if err != nil {
+		// GetDockerCommands has no error return; fall back to the historical
+		// Linux path rather than producing an unusable command.
+		binaryPath = DstackRunnerBinaryName
+	}
 	return []string{
 		// start runner
-		fmt.Sprintf("%s %s", DstackRunnerBinaryName, strings.Join(c.getRunnerArgs(), " ")),
+		fmt.Sprintf("%s %s", binaryPath, strings.Join(c.getRunnerArgs(), " ")),
+	}
+}
+
+// getContainerPortsAndMounts renders the -p/-v flags GetDockerCommands needs
+// for container mode; RunContainer (the Engine-API path) expresses the same
+// bindings as nat.PortMap/mount.Mount instead.
+func (c *CLIArgs) getContainerPortsAndMounts() []string {
+	port := strconv.Itoa(c.Runner.HTTPPort)
+	return []string{
+		fmt.Sprintf("-p %s:%s", port, port),
+		fmt.Sprintf("-v %s:%s", c.Runner.TempDir, c.Runner.TempDir),
+		fmt.Sprintf("-v %s:%s", c.Runner.HomeDir, c.Runner.HomeDir),
+		fmt.Sprintf("-v %s:%s", c.Runner.WorkingDir, c.Runner.WorkingDir),
+	}
+}
+
+// resolvedOS returns the OS to select a dstack-runner binary for: the
+// explicit --os override if set, otherwise the host's runtime.GOOS.
+func (c *CLIArgs) resolvedOS() string {
+	if c.Runner.OS != "" {
+		return c.Runner.OS
+	}
+	return runtime.GOOS
+}
+
+// resolvedArch returns the arch to select a dstack-runner binary for: the
+// explicit --arch override if set, otherwise the host's runtime.GOARCH.
+func (c *CLIArgs) resolvedArch() string {
+	if c.Runner.Arch != "" {
+		return c.Runner.Arch
 	}
+	return runtime.GOARCH
 }
 
+// DownloadRunner fetches and verifies the dstack-runner binary for the
+// resolved platform (the --os/--arch overrides if set, otherwise the host's).
+// In container mode there is no binary to place on disk: version
+// upgrades are image pulls, handled by RunContainer instead.
 func (c *CLIArgs) DownloadRunner() error {
-	url := makeDownloadRunnerUrl(c.Runner.Version, c.Runner.DevChannel)
+	if c.Runner.Mode == ModeContainer {
+		return nil
+	}
+
+	osName, archName := c.resolvedOS(), c.resolvedArch()
+	if err := validatePlatform(osName, archName); err != nil {
+		return gerrors.Wrap(err)
+	}
+
+	asset, err := c.runnerSource().ResolveAsset(context.Background(), c.Runner.Version, osName, archName)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Printf("Installing %s\n", asset.Description)
+
+	roots := signing.RootKeys
+	if c.Runner.RootKeysFile != "" {
+		data, err := os.ReadFile(c.Runner.RootKeysFile)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		roots, err = signing.LoadRootKeys(data)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+
+	skipSignature, skipSignatureReason := c.signatureSkip()
+	if !skipSignature && signing.IsPlaceholderRootKeys(roots) {
+		return gerrors.Newf("refusing to verify dstack-runner signatures against the placeholder root key compiled into this build (see signing.RootKeys); pass --root-keys-file with the real release root, or --insecure-skip-signature for local development")
+	}
 
-	runnerBinaryPath, err := downloadRunner(url)
+	runnerBinaryPath, err := downloadRunner(asset.URL, roots, skipSignature, skipSignatureReason, download.Options{
+		ProgressFunc: c.Runner.ProgressFunc,
+		MaxRetries:   c.Runner.MaxRetries,
+		// The S3 bucket publishes a <url>.sha256 sidecar; GitHub release
+		// assets don't follow that convention.
+		VerifyChecksum: c.Runner.Source != "github",
+	})
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
@@ -41,6 +205,73 @@ func (c *CLIArgs) DownloadRunner() error {
 	return nil
 }
 
+// signatureSkip reports whether DownloadRunner should skip dstack-runner
+// signature verification, and why: either the user opted out explicitly, or
+// the selected source doesn't publish a signing-keys.json/.sig layout to
+// verify against. GitHub Releases falls into the latter case; it still gets
+// TLS and the release's own immutable asset digest, just not our signing
+// scheme, so it must not be treated the same as an operator-requested
+// insecure bypass.
+func (c *CLIArgs) signatureSkip() (skip bool, reason string) {
+	if c.Runner.InsecureSkipSignature {
+		return true, "--insecure-skip-signature"
+	}
+	if c.Runner.Source == "github" {
+		return true, "GitHub Releases source"
+	}
+	return false, ""
+}
+
+// RunContainer runs dstack-runner as a Docker container via the Engine API,
+// pulling c.Runner.Version as an image tag and supervising it with
+// restart-on-crash. It only applies in container mode; callers in binary
+// mode use DownloadRunner and GetDockerCommands instead.
+func (c *CLIArgs) RunContainer(ctx context.Context) error {
+	supervisor, err := container.NewSupervisor()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+
+	if err := supervisor.Run(ctx, c.containerRunOptions()); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+// containerRunOptions translates RunnerArgs into the container package's own
+// RunOptions, shared by RunContainer (the Engine-API path) and
+// GetDockerCommands (the `docker run` string) so the two never pass the
+// runner different flags for the same Mode.
+func (c *CLIArgs) containerRunOptions() container.RunOptions {
+	return container.RunOptions{
+		Version:        c.Runner.Version,
+		LogLevel:       c.Runner.LogLevel,
+		HTTPPort:       c.Runner.HTTPPort,
+		TempDir:        c.Runner.TempDir,
+		HomeDir:        c.Runner.HomeDir,
+		WorkingDir:     c.Runner.WorkingDir,
+		RestartOnCrash: true,
+	}
+}
+
+// runnerSource returns the RunnerSource selected by Runner.Source, defaulting
+// to the original S3 bucket for backward compatibility. The GitHub source
+// doesn't (yet) publish the signing-keys.json/.sig layout that
+// verifyRunnerSignature expects, so DownloadRunner skips signature (and
+// checksum) verification automatically when this source is selected, rather
+// than requiring --insecure-skip-signature.
+func (c *CLIArgs) runnerSource() source.RunnerSource {
+	if c.Runner.Source == "github" {
+		return source.GitHubReleasesSource{Repo: DstackGitHubRepo}
+	}
+
+	bucket := DstackReleaseBucket
+	if c.Runner.DevChannel {
+		bucket = DstackStagingBucket
+	}
+	return source.S3Source{URLTemplate: DstackRunnerURL, Bucket: bucket}
+}
+
 func (c *CLIArgs) getRunnerArgs() []string {
 	return []string{
 		"--log-level", strconv.Itoa(c.Runner.LogLevel),
@@ -52,61 +283,184 @@ func (c *CLIArgs) getRunnerArgs() []string {
 	}
 }
 
-func makeDownloadRunnerUrl(version string, staging bool) string {
-	bucket := DstackReleaseBucket
-	if staging {
-		bucket = DstackStagingBucket
+// validatePlatform checks osName/archName against SupportedPlatforms,
+// returning a clear error if the release pipeline doesn't publish a
+// dstack-runner binary for that combination.
+func validatePlatform(osName, archName string) error {
+	archs, ok := SupportedPlatforms[osName]
+	if !ok {
+		return gerrors.Newf("unsupported OS %q: dstack-runner is published for %s", osName, supportedPlatformsList())
+	}
+	for _, a := range archs {
+		if a == archName {
+			return nil
+		}
 	}
+	return gerrors.Newf("unsupported platform %s/%s: dstack-runner is published for %s", osName, archName, supportedPlatformsList())
+}
 
-	osName := "linux"
-	archName := "amd64"
+func supportedPlatformsList() string {
+	var platforms []string
+	for osName, archs := range SupportedPlatforms {
+		for _, archName := range archs {
+			platforms = append(platforms, osName+"/"+archName)
+		}
+	}
+	sort.Strings(platforms)
+	return strings.Join(platforms, ", ")
+}
 
-	url := fmt.Sprintf(DstackRunnerURL, bucket, version, osName, archName)
-	return url
+// RunnerBinaryPath returns where the dstack-runner binary is installed for
+// osName, laying out non-Linux hosts the way other Go tools place
+// platform-specific state (e.g. under a per-user application support dir on
+// macOS rather than a Linux-style /usr/local/bin).
+func RunnerBinaryPath(osName string) (string, error) {
+	switch osName {
+	case "linux":
+		return DstackRunnerBinaryName, nil
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		return filepath.Join(home, "Library", "Application Support", "dstack", "bin", "dstack-runner"), nil
+	default:
+		return "", gerrors.Newf("unsupported OS: %s", osName)
+	}
 }
 
-func downloadRunner(url string) (string, error) {
-	tempFile, err := os.CreateTemp("", "dstack-runner")
-	if err != nil {
+// downloadRunner fetches url into a deterministic path under the OS temp
+// dir so an interrupted download can be resumed on retry, then verifies its
+// signature (unless skipSignature) before making it executable.
+func downloadRunner(url string, roots []ed25519.PublicKey, skipSignature bool, skipSignatureReason string, opts download.Options) (string, error) {
+	destPath := filepath.Join(os.TempDir(), "dstack-runner-"+urlDigest(url))
+
+	if err := download.Download(context.Background(), url, destPath, opts); err != nil {
 		return "", gerrors.Wrap(err)
 	}
+	// On any error past this point we must not leave a binary behind that
+	// looks installed but was never verified.
+	success := false
 	defer func() {
-		err := tempFile.Close()
-		if err != nil {
-			log.Printf("close file error: %s\n", err)
+		if !success {
+			_ = os.Remove(destPath)
 		}
 	}()
 
-	log.Printf("Downloading runner from %s\n", url)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*600)
-	defer cancel()
+	if skipSignature {
+		log.Printf("WARNING: skipping dstack-runner signature verification (%s)\n", skipSignatureReason)
+	} else if err := verifyRunnerSignature(url, destPath, roots); err != nil {
+		if isNotFoundErr(err) {
+			// The bucket doesn't publish signing-keys.json for this binary
+			// (yet) rather than publishing one that fails to verify; don't
+			// turn a missing optional artifact into a hard install failure.
+			log.Printf("WARNING: skipping dstack-runner signature verification (no signing-keys.json published for this bucket yet: %s)\n", err)
+		} else {
+			return "", gerrors.Wrap(err)
+		}
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
+	if err := os.Chmod(destPath, 0755); err != nil {
 		return "", gerrors.Wrap(err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	success = true
+	return destPath, nil
+}
+
+// urlDigest derives a stable, filesystem-safe identifier for url so repeated
+// downloads of the same version reuse (and can resume) the same dest path.
+func urlDigest(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// verifyRunnerSignature fetches the signing-keys manifest and the binary's
+// detached signature from the same bucket as url, and verifies both the
+// manifest (against roots) and the binary (against the manifest). The
+// manifest fetch's error is returned unwrapped so downloadRunner can tell a
+// bucket that simply doesn't publish signing-keys.json (isNotFoundErr) apart
+// from a real verification failure.
+func verifyRunnerSignature(url string, binaryPath string, roots []ed25519.PublicKey) error {
+	manifestURL, err := signingKeysURL(url)
 	if err != nil {
-		return "", gerrors.Wrap(err)
+		return gerrors.Wrap(err)
 	}
-	defer func() {
-		err := resp.Body.Close()
-		log.Printf("close body error: %s\n", err)
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", gerrors.Newf("unexpected status code: %s", resp.Status)
+	manifestData, err := fetch(manifestURL)
+	if err != nil {
+		return err
 	}
 
-	_, err = io.Copy(tempFile, resp.Body)
+	sm, manifest, err := signing.ParseManifest(manifestData)
 	if err != nil {
-		return "", gerrors.Wrap(err)
+		return gerrors.Wrap(err)
+	}
+
+	if err := signing.VerifyManifest(sm, manifest, roots, time.Now()); err != nil {
+		return gerrors.Wrap(err)
+	}
+
+	sigData, err := fetch(url + ".sig")
+	if err != nil {
+		return gerrors.Wrap(err)
 	}
 
-	if err := tempFile.Chmod(0755); err != nil {
+	binary, err := os.ReadFile(binaryPath)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+
+	if err := signing.VerifyBinary(binary, sigData, manifest); err != nil {
+		return gerrors.Wrap(err)
+	}
+
+	return nil
+}
+
+// signingKeysURL returns the signing-keys.json location for the bucket that
+// serves binaryURL: the same scheme and host, at the bucket root.
+func signingKeysURL(binaryURL string) (string, error) {
+	u, err := url.Parse(binaryURL)
+	if err != nil {
 		return "", gerrors.Wrap(err)
 	}
+	u.Path = "/signing-keys.json"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// fetch returns a *fetchError, not wrapped by gerrors, when the server
+// responds with a non-200 status - isNotFoundErr needs to see the raw type
+// to tell a 404 apart from a real failure.
+func fetch(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &fetchError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+type fetchError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *fetchError) Error() string {
+	return fmt.Sprintf("unexpected status code fetching %s: %s", e.url, e.status)
+}
 
-	return tempFile.Name(), nil
+// isNotFoundErr reports whether err is an HTTP 404 from fetch, used to tell
+// "this bucket doesn't publish signing metadata yet" apart from a real
+// verification failure.
+func isNotFoundErr(err error) bool {
+	var fe *fetchError
+	return errors.As(err, &fe) && fe.code == http.StatusNotFound
 }
@@ -0,0 +1,174 @@
+package shim
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/shim/source"
+)
+
+func TestValidatePlatformAndS3SourceURL(t *testing.T) {
+	cases := []struct {
+		name      string
+		os, arch  string
+		wantErr   bool
+		wantInURL string
+	}{
+		{name: "linux/amd64", os: "linux", arch: "amd64", wantInURL: "dstack-runner-linux-amd64"},
+		{name: "linux/arm64", os: "linux", arch: "arm64", wantInURL: "dstack-runner-linux-arm64"},
+		{name: "linux/ppc64le", os: "linux", arch: "ppc64le", wantInURL: "dstack-runner-linux-ppc64le"},
+		{name: "linux/s390x", os: "linux", arch: "s390x", wantInURL: "dstack-runner-linux-s390x"},
+		{name: "darwin/arm64", os: "darwin", arch: "arm64", wantInURL: "dstack-runner-darwin-arm64"},
+		{name: "unpublished arch", os: "linux", arch: "riscv64", wantErr: true},
+		{name: "unpublished os", os: "windows", arch: "amd64", wantErr: true},
+		{name: "unpublished darwin arch", os: "darwin", arch: "amd64", wantErr: true},
+	}
+
+	s3 := source.S3Source{URLTemplate: DstackRunnerURL, Bucket: DstackReleaseBucket}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validatePlatform(tc.os, tc.arch)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for %s/%s", tc.os, tc.arch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			asset, err := s3.ResolveAsset(context.Background(), "0.18.3", tc.os, tc.arch)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !strings.Contains(asset.URL, tc.wantInURL) {
+				t.Fatalf("expected url to contain %q, got %q", tc.wantInURL, asset.URL)
+			}
+		})
+	}
+}
+
+func TestCLIArgsResolvedOSArchOverride(t *testing.T) {
+	c := &CLIArgs{Runner: RunnerArgs{OS: "darwin", Arch: "arm64"}}
+
+	if got := c.resolvedOS(); got != "darwin" {
+		t.Fatalf("expected override darwin, got %q", got)
+	}
+	if got := c.resolvedArch(); got != "arm64" {
+		t.Fatalf("expected override arm64, got %q", got)
+	}
+}
+
+func TestCLIArgsResolvedOSArchAutoDetect(t *testing.T) {
+	c := &CLIArgs{}
+
+	if got := c.resolvedOS(); got == "" {
+		t.Fatalf("expected auto-detected OS, got empty string")
+	}
+	if got := c.resolvedArch(); got == "" {
+		t.Fatalf("expected auto-detected arch, got empty string")
+	}
+}
+
+func TestCLIArgsRunnerSource(t *testing.T) {
+	s3 := (&CLIArgs{}).runnerSource()
+	if _, ok := s3.(source.S3Source); !ok {
+		t.Fatalf("expected default source to be S3Source, got %T", s3)
+	}
+
+	gh := (&CLIArgs{Runner: RunnerArgs{Source: "github"}}).runnerSource()
+	if _, ok := gh.(source.GitHubReleasesSource); !ok {
+		t.Fatalf("expected \"github\" source to be GitHubReleasesSource, got %T", gh)
+	}
+}
+
+func TestDownloadRunnerRefusesPlaceholderRootKeys(t *testing.T) {
+	c := &CLIArgs{Runner: RunnerArgs{Version: "0.18.3", OS: "linux", Arch: "amd64"}}
+
+	err := c.DownloadRunner()
+	if err == nil {
+		t.Fatalf("expected an error refusing to verify against the placeholder root key")
+	}
+}
+
+func TestCLIArgsSignatureSkip(t *testing.T) {
+	cases := []struct {
+		name     string
+		runner   RunnerArgs
+		wantSkip bool
+	}{
+		{name: "default s3 verifies", runner: RunnerArgs{}, wantSkip: false},
+		{name: "insecure flag skips", runner: RunnerArgs{InsecureSkipSignature: true}, wantSkip: true},
+		{name: "github source skips without the insecure flag", runner: RunnerArgs{Source: "github"}, wantSkip: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &CLIArgs{Runner: tc.runner}
+			skip, reason := c.signatureSkip()
+			if skip != tc.wantSkip {
+				t.Fatalf("expected skip=%v, got %v (reason %q)", tc.wantSkip, skip, reason)
+			}
+			if skip && reason == "" {
+				t.Fatalf("expected a non-empty reason when skipping")
+			}
+		})
+	}
+}
+
+func TestGetDockerCommandsContainerMode(t *testing.T) {
+	c := &CLIArgs{Runner: RunnerArgs{
+		Mode:       ModeContainer,
+		Version:    "0.18.3",
+		LogLevel:   4,
+		HTTPPort:   10999,
+		TempDir:    "/tmp/dstack",
+		HomeDir:    "/root",
+		WorkingDir: "/root/workflow",
+	}}
+
+	cmds := c.GetDockerCommands()
+	if len(cmds) != 1 {
+		t.Fatalf("expected exactly one command, got %d", len(cmds))
+	}
+
+	want := []string{
+		"docker run --rm --name dstack-runner",
+		"-p 10999:10999",
+		"-v /tmp/dstack:/tmp/dstack",
+		"dstackai/dstack-runner:0.18.3",
+		"--log-level 4",
+		"--http-port 10999",
+		"--temp-dir /tmp/dstack",
+	}
+	for _, substr := range want {
+		if !strings.Contains(cmds[0], substr) {
+			t.Fatalf("expected command to contain %q, got %q", substr, cmds[0])
+		}
+	}
+}
+
+func TestRunnerBinaryPath(t *testing.T) {
+	path, err := RunnerBinaryPath("linux")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if path != DstackRunnerBinaryName {
+		t.Fatalf("expected linux path %q, got %q", DstackRunnerBinaryName, path)
+	}
+
+	path, err = RunnerBinaryPath("darwin")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(path, "Library/Application Support/dstack/bin") {
+		t.Fatalf("expected darwin path under Application Support, got %q", path)
+	}
+
+	if _, err := RunnerBinaryPath("plan9"); err == nil {
+		t.Fatalf("expected an error for an unsupported OS")
+	}
+}
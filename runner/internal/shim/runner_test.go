@@ -0,0 +1,166 @@
+package shim
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/shim/download"
+	"github.com/dstackai/dstack/runner/internal/signing"
+)
+
+// newFakeRunnerServer serves a binary, its detached signature and a
+// signing-keys manifest signed by rootPriv, mimicking the release bucket
+// layout that downloadRunner expects.
+func newFakeRunnerServer(t *testing.T, rootPriv ed25519.PrivateKey, binary []byte, manifestOverride func(signing.Manifest) signing.Manifest) *httptest.Server {
+	t.Helper()
+
+	signingPub, signingPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate signing key: %s", err)
+	}
+
+	manifest := signing.Manifest{
+		Keys: []signing.SigningKey{
+			{ID: "key-1", Key: base64.StdEncoding.EncodeToString(signingPub)},
+		},
+		Expires: time.Now().Add(24 * time.Hour),
+	}
+	if manifestOverride != nil {
+		manifest = manifestOverride(manifest)
+	}
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("marshal manifest: %s", err)
+	}
+
+	manifestJSON, err := json.Marshal(signing.SignedManifest{
+		Signed:    payload,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(rootPriv, payload)),
+	})
+	if err != nil {
+		t.Fatalf("marshal signed manifest: %s", err)
+	}
+
+	sum := sha256.Sum256(binary)
+	sig := ed25519.Sign(signingPriv, sum[:])
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(binary)
+	})
+	mux.HandleFunc("/binary.sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(sig)
+	})
+	mux.HandleFunc("/signing-keys.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(manifestJSON)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestDownloadRunnerVerifiesSignature(t *testing.T) {
+	rootPub, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate root key: %s", err)
+	}
+	roots := []ed25519.PublicKey{rootPub}
+	binary := []byte("fake dstack-runner binary contents")
+
+	t.Run("valid signature", func(t *testing.T) {
+		server := newFakeRunnerServer(t, rootPriv, binary, nil)
+		defer server.Close()
+
+		path, err := downloadRunner(server.URL+"/binary", roots, false, "", download.Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer os.Remove(path)
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read downloaded binary: %s", err)
+		}
+		if string(got) != string(binary) {
+			t.Fatalf("downloaded binary does not match source")
+		}
+	})
+
+	t.Run("expired manifest is rejected", func(t *testing.T) {
+		server := newFakeRunnerServer(t, rootPriv, binary, func(m signing.Manifest) signing.Manifest {
+			m.Expires = time.Now().Add(-time.Hour)
+			return m
+		})
+		defer server.Close()
+
+		_, err := downloadRunner(server.URL+"/binary", roots, false, "", download.Options{})
+		if err == nil {
+			t.Fatalf("expected error for expired manifest")
+		}
+	})
+
+	t.Run("revoked signing key is rejected", func(t *testing.T) {
+		server := newFakeRunnerServer(t, rootPriv, binary, func(m signing.Manifest) signing.Manifest {
+			m.Keys[0].Revoked = true
+			return m
+		})
+		defer server.Close()
+
+		_, err := downloadRunner(server.URL+"/binary", roots, false, "", download.Options{})
+		if err == nil {
+			t.Fatalf("expected error for revoked signing key")
+		}
+	})
+
+	t.Run("insecure skip signature bypasses verification", func(t *testing.T) {
+		server := newFakeRunnerServer(t, rootPriv, binary, func(m signing.Manifest) signing.Manifest {
+			m.Expires = time.Now().Add(-time.Hour) // would otherwise be rejected
+			return m
+		})
+		defer server.Close()
+
+		path, err := downloadRunner(server.URL+"/binary", roots, true, "--insecure-skip-signature", download.Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		os.Remove(path)
+	})
+
+	t.Run("untampered download against untrusted roots fails", func(t *testing.T) {
+		server := newFakeRunnerServer(t, rootPriv, binary, nil)
+		defer server.Close()
+
+		otherPub, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("generate key: %s", err)
+		}
+
+		_, err = downloadRunner(server.URL+"/binary", []ed25519.PublicKey{otherPub}, false, "", download.Options{})
+		if err == nil {
+			t.Fatalf("expected error verifying against an untrusted root")
+		}
+	})
+
+	t.Run("missing signing-keys.json is not fatal", func(t *testing.T) {
+		// A bucket that doesn't publish signing-keys.json at all (a 404, not
+		// a broken one) shouldn't block installing the binary.
+		mux := http.NewServeMux()
+		mux.HandleFunc("/binary", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(binary)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		path, err := downloadRunner(server.URL+"/binary", roots, false, "", download.Options{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		os.Remove(path)
+	})
+}
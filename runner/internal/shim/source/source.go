@@ -0,0 +1,118 @@
+// Package source resolves where to download a dstack-runner binary from:
+// the original S3 release bucket, or GitHub Releases as an escape hatch when
+// the bucket is unreachable or geo-restricted.
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// Asset is a resolved dstack-runner download location.
+type Asset struct {
+	URL string
+	// Description is a human-readable line the caller can log, e.g.
+	// "dstack-runner v0.18.3 (released 2024-11-02)".
+	Description string
+}
+
+// RunnerSource resolves the download URL for a dstack-runner build matching
+// version/osName/archName.
+type RunnerSource interface {
+	ResolveAsset(ctx context.Context, version, osName, archName string) (Asset, error)
+}
+
+// S3Source is the original dstack-runner distribution channel: a versioned
+// S3 bucket keyed by release.
+type S3Source struct {
+	// URLTemplate is a printf template taking (bucket, version, os, arch),
+	// e.g. shim.DstackRunnerURL.
+	URLTemplate string
+	Bucket      string
+}
+
+func (s S3Source) ResolveAsset(ctx context.Context, version, osName, archName string) (Asset, error) {
+	return Asset{
+		URL:         fmt.Sprintf(s.URLTemplate, s.Bucket, version, osName, archName),
+		Description: fmt.Sprintf("dstack-runner %s", version),
+	}, nil
+}
+
+// githubAPIBase is overridden in tests to point at a fake server.
+var githubAPIBase = "https://api.github.com"
+
+// GitHubReleasesSource resolves dstack-runner binaries from GitHub Releases.
+type GitHubReleasesSource struct {
+	// Repo is "owner/name", e.g. "dstackai/dstack".
+	Repo string
+	// Token, if set, is sent as a bearer token to raise GitHub's anonymous
+	// rate limit. Falls back to the GITHUB_TOKEN env var.
+	Token string
+}
+
+type githubRelease struct {
+	TagName     string        `json:"tag_name"`
+	PublishedAt time.Time     `json:"published_at"`
+	Assets      []githubAsset `json:"assets"`
+}
+
+type githubAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+func (s GitHubReleasesSource) ResolveAsset(ctx context.Context, version, osName, archName string) (Asset, error) {
+	tag := "tags/" + version
+	if version == "" || version == "latest" {
+		tag = "latest"
+	}
+	releaseURL := fmt.Sprintf("%s/repos/%s/releases/%s", githubAPIBase, s.Repo, tag)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releaseURL, nil)
+	if err != nil {
+		return Asset{}, gerrors.Wrap(err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := s.token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Asset{}, gerrors.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Asset{}, gerrors.Newf("unexpected status code fetching GitHub release %s: %s", tag, resp.Status)
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return Asset{}, gerrors.Wrap(err)
+	}
+
+	assetName := fmt.Sprintf("dstack-runner-%s-%s", osName, archName)
+	for _, a := range release.Assets {
+		if a.Name == assetName {
+			return Asset{
+				URL:         a.BrowserDownloadURL,
+				Description: fmt.Sprintf("dstack-runner %s (released %s)", release.TagName, release.PublishedAt.Format("2006-01-02")),
+			}, nil
+		}
+	}
+	return Asset{}, gerrors.Newf("release %s has no asset named %s", release.TagName, assetName)
+}
+
+func (s GitHubReleasesSource) token() string {
+	if s.Token != "" {
+		return s.Token
+	}
+	return os.Getenv("GITHUB_TOKEN")
+}
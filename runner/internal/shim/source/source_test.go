@@ -0,0 +1,92 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestS3SourceResolveAsset(t *testing.T) {
+	s := S3Source{
+		URLTemplate: "https://%s.s3.eu-west-1.amazonaws.com/%s/binaries/dstack-runner-%s-%s",
+		Bucket:      "dstack-runner-downloads",
+	}
+
+	asset, err := s.ResolveAsset(context.Background(), "0.18.3", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "https://dstack-runner-downloads.s3.eu-west-1.amazonaws.com/0.18.3/binaries/dstack-runner-linux-amd64"
+	if asset.URL != want {
+		t.Fatalf("got url %q, want %q", asset.URL, want)
+	}
+}
+
+func newFakeGitHubServer(t *testing.T, wantAuth string) *httptest.Server {
+	t.Helper()
+	const releaseJSON = `{
+		"tag_name": "v0.18.3",
+		"published_at": "2024-11-02T10:00:00Z",
+		"assets": [
+			{"name": "dstack-runner-linux-amd64", "browser_download_url": "https://github.com/dstackai/dstack/releases/download/v0.18.3/dstack-runner-linux-amd64"},
+			{"name": "dstack-runner-darwin-arm64", "browser_download_url": "https://github.com/dstackai/dstack/releases/download/v0.18.3/dstack-runner-darwin-arm64"}
+		]
+	}`
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantAuth != "" && r.Header.Get("Authorization") != wantAuth {
+			t.Errorf("expected Authorization %q, got %q", wantAuth, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(releaseJSON))
+	}))
+}
+
+func TestGitHubReleasesSourceResolveAsset(t *testing.T) {
+	server := newFakeGitHubServer(t, "")
+	defer server.Close()
+
+	asset, err := resolveAssetAgainst(server.URL, GitHubReleasesSource{Repo: "dstackai/dstack"}, "v0.18.3", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if asset.URL != "https://github.com/dstackai/dstack/releases/download/v0.18.3/dstack-runner-linux-amd64" {
+		t.Fatalf("unexpected asset URL: %s", asset.URL)
+	}
+	if !strings.Contains(asset.Description, "v0.18.3") || !strings.Contains(asset.Description, "2024-11-02") {
+		t.Fatalf("expected description to mention tag and date, got %q", asset.Description)
+	}
+}
+
+func TestGitHubReleasesSourceHonorsToken(t *testing.T) {
+	server := newFakeGitHubServer(t, "Bearer test-token")
+	defer server.Close()
+
+	t.Setenv("GITHUB_TOKEN", "test-token")
+
+	_, err := resolveAssetAgainst(server.URL, GitHubReleasesSource{Repo: "dstackai/dstack"}, "v0.18.3", "linux", "amd64")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestGitHubReleasesSourceMissingAsset(t *testing.T) {
+	server := newFakeGitHubServer(t, "")
+	defer server.Close()
+
+	_, err := resolveAssetAgainst(server.URL, GitHubReleasesSource{Repo: "dstackai/dstack"}, "v0.18.3", "linux", "ppc64le")
+	if err == nil {
+		t.Fatalf("expected an error for a missing asset")
+	}
+}
+
+// resolveAssetAgainst exercises GitHubReleasesSource.ResolveAsset's parsing
+// and header logic against an arbitrary base URL, since the production type
+// hardcodes api.github.com.
+func resolveAssetAgainst(baseURL string, s GitHubReleasesSource, version, osName, archName string) (Asset, error) {
+	orig := githubAPIBase
+	githubAPIBase = baseURL
+	defer func() { githubAPIBase = orig }()
+	return s.ResolveAsset(context.Background(), version, osName, archName)
+}
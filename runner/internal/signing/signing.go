@@ -0,0 +1,181 @@
+// Package signing verifies the authenticity of dstack-runner binaries
+// published to the release bucket. It implements a small distsign-style
+// scheme: a set of long-lived root keys (compiled into the shim) sign a
+// manifest of shorter-lived signing keys, and the signing keys in turn sign
+// each published binary.
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// RootKeys are the dstack release root public keys, compiled into the shim.
+// They only ever sign the signing-keys manifest, never binaries directly, so
+// they can stay offline and rarely rotate.
+//
+// TODO: the key below is a PLACEHOLDER generated for this checkout - no
+// corresponding private key exists, so a genuinely-signed manifest can never
+// verify against it. Replace it with the real dstack release root before
+// shipping a build that verifies signatures by default. Until then,
+// IsPlaceholderRootKeys lets callers refuse to run verification against it
+// instead of guaranteeing every production download a signature failure.
+var RootKeys = []ed25519.PublicKey{
+	mustDecodeKey("zJj4AVk+9oWq4f3m2H0dF3y1n7Y8bV1r3p8QyqzQW3g="),
+}
+
+// IsPlaceholderRootKeys reports whether roots is exactly the placeholder
+// RootKeys above, rather than a real compiled-in or --root-keys-file root.
+func IsPlaceholderRootKeys(roots []ed25519.PublicKey) bool {
+	if len(roots) != len(RootKeys) {
+		return false
+	}
+	for i := range roots {
+		if !bytes.Equal(roots[i], RootKeys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Manifest is the parsed "signed" section of signing-keys.json: the current
+// set of trusted signing keys and when they expire.
+type Manifest struct {
+	Keys    []SigningKey `json:"keys"`
+	Expires time.Time    `json:"expires"`
+}
+
+// SignedManifest is signing-keys.json as published: a Manifest plus the root
+// signature over it. Signed is kept as the exact bytes that were delivered
+// and actually signed, rather than Go's own re-serialization of Manifest, so
+// VerifyManifest checks what was really on the wire - a field this package
+// doesn't model, or a time.Time that round-trips through a different
+// textual format, can't turn a genuine signature into a spurious failure or
+// let a tampered field slip past unnoticed.
+type SignedManifest struct {
+	Signed    json.RawMessage `json:"signed"`
+	Signature string          `json:"signature"` // base64 ed25519 signature over Signed
+}
+
+// SigningKey is a single signing key entry in the manifest.
+type SigningKey struct {
+	ID      string `json:"id"`
+	Key     string `json:"key"` // base64 ed25519 public key
+	Revoked bool   `json:"revoked"`
+}
+
+// mustDecodeKey decodes a compiled-in root key constant. It panics on a
+// malformed constant - acceptable here since it only ever runs at package
+// init against a value this package's own author controls, unlike
+// LoadRootKeys below, which must reject a bad key from a file at runtime
+// instead of crashing the process.
+func mustDecodeKey(s string) ed25519.PublicKey {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		panic(fmt.Sprintf("signing: compiled-in root key is %d bytes, want %d", len(b), ed25519.PublicKeySize))
+	}
+	return ed25519.PublicKey(b)
+}
+
+// VerifyManifest checks sm's root signature over its exact Signed payload,
+// and m's expiry, against the given set of trusted root keys. m must be the
+// Manifest ParseManifest decoded from sm.Signed.
+func VerifyManifest(sm SignedManifest, m Manifest, roots []ed25519.PublicKey, now time.Time) error {
+	if now.After(m.Expires) {
+		return gerrors.Newf("signing-keys manifest expired at %s", m.Expires)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sm.Signature)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+
+	for _, root := range roots {
+		if len(root) != ed25519.PublicKeySize {
+			// ed25519.Verify panics on a key of the wrong length; a
+			// malformed --root-keys-file entry must fail verification, not
+			// crash the shim.
+			continue
+		}
+		if ed25519.Verify(root, sm.Signed, sig) {
+			return nil
+		}
+	}
+	return gerrors.Newf("signing-keys manifest signature does not match any root key")
+}
+
+// VerifyBinary checks a <binary>.sig payload against the non-revoked signing
+// keys in a manifest that has already passed VerifyManifest.
+func VerifyBinary(binary []byte, sig []byte, m Manifest) error {
+	sum := sha256.Sum256(binary)
+
+	for _, sk := range m.Keys {
+		if sk.Revoked {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(sk.Key)
+		if err != nil {
+			continue
+		}
+		if len(key) != ed25519.PublicKeySize {
+			// Same as VerifyManifest: a malformed manifest entry must fail
+			// verification, not crash ed25519.Verify.
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(key), sum[:], sig) {
+			return nil
+		}
+	}
+	return gerrors.Newf("binary signature does not match any trusted signing key")
+}
+
+// ParseManifest unmarshals signing-keys.json into its signed envelope and
+// the Manifest decoded from the envelope's Signed payload. Callers pass both
+// to VerifyManifest.
+func ParseManifest(data []byte) (SignedManifest, Manifest, error) {
+	var sm SignedManifest
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return SignedManifest{}, Manifest{}, gerrors.Wrap(err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(sm.Signed, &m); err != nil {
+		return SignedManifest{}, Manifest{}, gerrors.Wrap(err)
+	}
+	return sm, m, nil
+}
+
+// LoadRootKeys reads root keys from a JSON file of base64-encoded ed25519
+// public keys, used to override RootKeys in tests and other non-production
+// scenarios. Unlike mustDecodeKey, a malformed entry here is an operator
+// mistake in a file read at runtime, not a bug in this package, so it's
+// reported as an error rather than a panic.
+func LoadRootKeys(data []byte) ([]ed25519.PublicKey, error) {
+	var encoded []string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+
+	keys := make([]ed25519.PublicKey, 0, len(encoded))
+	for _, e := range encoded {
+		b, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		if len(b) != ed25519.PublicKeySize {
+			return nil, gerrors.Newf("root key is %d bytes, want %d", len(b), ed25519.PublicKeySize)
+		}
+		keys = append(keys, ed25519.PublicKey(b))
+	}
+	return keys, nil
+}
@@ -0,0 +1,197 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildSignedManifestJSON marshals m, signs it with root, and wraps both
+// into the on-disk signing-keys.json shape, the same way a real publisher
+// would.
+func buildSignedManifestJSON(t *testing.T, root ed25519.PrivateKey, m Manifest) []byte {
+	t.Helper()
+	payload, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("marshal manifest: %s", err)
+	}
+
+	sm := SignedManifest{
+		Signed:    payload,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(root, payload)),
+	}
+	data, err := json.Marshal(sm)
+	if err != nil {
+		t.Fatalf("marshal signed manifest: %s", err)
+	}
+	return data
+}
+
+func TestVerifyManifestAndBinary(t *testing.T) {
+	rootPub, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate root key: %s", err)
+	}
+	signingPub, signingPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate signing key: %s", err)
+	}
+
+	roots := []ed25519.PublicKey{rootPub}
+	binary := []byte("fake dstack-runner binary contents")
+	sum := sha256.Sum256(binary)
+	validSig := ed25519.Sign(signingPriv, sum[:])
+
+	baseManifest := Manifest{
+		Keys: []SigningKey{
+			{ID: "key-1", Key: base64.StdEncoding.EncodeToString(signingPub)},
+		},
+		Expires: time.Now().Add(24 * time.Hour),
+	}
+
+	cases := []struct {
+		name       string
+		data       func() []byte
+		sig        []byte
+		wantManErr bool
+		wantBinErr bool
+	}{
+		{
+			name: "valid",
+			data: func() []byte { return buildSignedManifestJSON(t, rootPriv, baseManifest) },
+			sig:  validSig,
+		},
+		{
+			name: "tampered manifest",
+			data: func() []byte {
+				// Modify the signed payload on the wire without re-signing it,
+				// the way an attacker who doesn't hold the root key would have to.
+				data := buildSignedManifestJSON(t, rootPriv, baseManifest)
+				return []byte(strings.Replace(string(data), `"id":"key-1"`, `"id":"tampered"`, 1))
+			},
+			sig:        validSig,
+			wantManErr: true,
+		},
+		{
+			name: "expired manifest",
+			data: func() []byte {
+				m := baseManifest
+				m.Expires = time.Now().Add(-time.Hour)
+				return buildSignedManifestJSON(t, rootPriv, m)
+			},
+			sig:        validSig,
+			wantManErr: true,
+		},
+		{
+			name: "revoked signing key",
+			data: func() []byte {
+				m := baseManifest
+				m.Keys = []SigningKey{{ID: "key-1", Key: base64.StdEncoding.EncodeToString(signingPub), Revoked: true}}
+				return buildSignedManifestJSON(t, rootPriv, m)
+			},
+			sig:        validSig,
+			wantBinErr: true,
+		},
+		{
+			name:       "tampered binary signature",
+			data:       func() []byte { return buildSignedManifestJSON(t, rootPriv, baseManifest) },
+			sig:        ed25519.Sign(signingPriv, []byte("wrong payload")),
+			wantBinErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sm, m, err := ParseManifest(tc.data())
+			if err != nil {
+				t.Fatalf("parse manifest: %s", err)
+			}
+
+			err = VerifyManifest(sm, m, roots, time.Now())
+			if tc.wantManErr {
+				if err == nil {
+					t.Fatalf("expected manifest verification error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected manifest verification error: %s", err)
+			}
+
+			err = VerifyBinary(binary, tc.sig, m)
+			if tc.wantBinErr && err == nil {
+				t.Fatalf("expected binary verification error, got nil")
+			}
+			if !tc.wantBinErr && err != nil {
+				t.Fatalf("unexpected binary verification error: %s", err)
+			}
+		})
+	}
+}
+
+func TestVerifyManifestUntrustedRoot(t *testing.T) {
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	trustedPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	data := buildSignedManifestJSON(t, otherPriv, Manifest{Expires: time.Now().Add(time.Hour)})
+	sm, m, err := ParseManifest(data)
+	if err != nil {
+		t.Fatalf("parse manifest: %s", err)
+	}
+
+	if err := VerifyManifest(sm, m, []ed25519.PublicKey{trustedPub}, time.Now()); err == nil {
+		t.Fatalf("expected error verifying manifest signed by an untrusted root")
+	}
+}
+
+func TestVerifyManifestRejectsWrongLengthRootKey(t *testing.T) {
+	_, rootPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate root key: %s", err)
+	}
+
+	data := buildSignedManifestJSON(t, rootPriv, Manifest{Expires: time.Now().Add(time.Hour)})
+	sm, m, err := ParseManifest(data)
+	if err != nil {
+		t.Fatalf("parse manifest: %s", err)
+	}
+
+	shortRoot := ed25519.PublicKey([]byte{1, 2, 3})
+	if err := VerifyManifest(sm, m, []ed25519.PublicKey{shortRoot}, time.Now()); err == nil {
+		t.Fatalf("expected an error, not a panic, verifying against a wrong-length root key")
+	}
+}
+
+func TestVerifyBinaryRejectsWrongLengthSigningKey(t *testing.T) {
+	binary := []byte("fake dstack-runner binary contents")
+	sig := []byte("not a real signature")
+
+	m := Manifest{
+		Keys: []SigningKey{{ID: "key-1", Key: base64.StdEncoding.EncodeToString([]byte{1, 2, 3})}},
+	}
+
+	if err := VerifyBinary(binary, sig, m); err == nil {
+		t.Fatalf("expected an error, not a panic, verifying against a wrong-length signing key")
+	}
+}
+
+func TestLoadRootKeysRejectsWrongLengthKey(t *testing.T) {
+	data, err := json.Marshal([]string{base64.StdEncoding.EncodeToString([]byte{1, 2, 3})})
+	if err != nil {
+		t.Fatalf("marshal fixture: %s", err)
+	}
+
+	if _, err := LoadRootKeys(data); err == nil {
+		t.Fatalf("expected an error, not a panic, loading a wrong-length root key")
+	}
+}